@@ -0,0 +1,242 @@
+package openvswitch
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const nlaHdrLen = 4
+
+// netlink attribute type flags that live in the top bits of the type
+// field; we don't care about them but need to mask them off before
+// comparing against our own OVS_*_ATTR_* constants.
+const nlaTypeMask = 0x3fff
+
+// AttrBuilder accumulates netlink attributes into a single byte
+// buffer, padding each one to the required 4-byte alignment.
+type AttrBuilder struct {
+	buf []byte
+}
+
+func NewAttrBuilder() *AttrBuilder {
+	return &AttrBuilder{}
+}
+
+func (b *AttrBuilder) Bytes() []byte {
+	return b.buf
+}
+
+func (b *AttrBuilder) putBytes(typ uint16, data []byte) {
+	hdr := make([]byte, nlaHdrLen)
+	binary.LittleEndian.PutUint16(hdr[0:2], uint16(nlaHdrLen+len(data)))
+	binary.LittleEndian.PutUint16(hdr[2:4], typ)
+
+	b.buf = append(b.buf, hdr...)
+	b.buf = append(b.buf, data...)
+
+	for len(b.buf)%nlmsgAlignTo != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+func (b *AttrBuilder) PutEmpty(typ uint16) {
+	b.putBytes(typ, nil)
+}
+
+func (b *AttrBuilder) PutUint8(typ uint16, v uint8) {
+	b.putBytes(typ, []byte{v})
+}
+
+func (b *AttrBuilder) PutUint16(typ uint16, v uint16) {
+	buf := make([]byte, 2)
+	binary.LittleEndian.PutUint16(buf, v)
+	b.putBytes(typ, buf)
+}
+
+func (b *AttrBuilder) PutUint32(typ uint16, v uint32) {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, v)
+	b.putBytes(typ, buf)
+}
+
+func (b *AttrBuilder) PutUint64(typ uint16, v uint64) {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+	b.putBytes(typ, buf)
+}
+
+func (b *AttrBuilder) PutUint16BE(typ uint16, v uint16) {
+	buf := make([]byte, 2)
+	binary.BigEndian.PutUint16(buf, v)
+	b.putBytes(typ, buf)
+}
+
+func (b *AttrBuilder) PutUint32BE(typ uint16, v uint32) {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, v)
+	b.putBytes(typ, buf)
+}
+
+func (b *AttrBuilder) PutSlice(typ uint16, v []byte) {
+	b.putBytes(typ, v)
+}
+
+// PutUint32Array writes vs as a single attribute containing a packed
+// array of native-endian uint32s, as used by OVS_VPORT_ATTR_UPCALL_PID.
+func (b *AttrBuilder) PutUint32Array(typ uint16, vs []uint32) {
+	data := make([]byte, 4*len(vs))
+	for i, v := range vs {
+		binary.LittleEndian.PutUint32(data[4*i:], v)
+	}
+	b.putBytes(typ, data)
+}
+
+func (b *AttrBuilder) PutString(typ uint16, s string) {
+	b.putBytes(typ, append([]byte(s), 0))
+}
+
+// PutNestedAttrs writes nested's accumulated attributes as the payload
+// of a single attribute of the given type.
+func (b *AttrBuilder) PutNestedAttrs(typ uint16, nested *AttrBuilder) {
+	b.putBytes(typ, nested.buf)
+}
+
+// rawAttr is one netlink attribute as it appeared on the wire, used
+// where attribute order or repetition matters (e.g. action lists),
+// unlike Attrs which collapses everything into a map.
+type rawAttr struct {
+	Type    uint16
+	Payload []byte
+}
+
+func parseAttrsOrdered(data []byte) ([]rawAttr, error) {
+	var attrs []rawAttr
+
+	for len(data) > 0 {
+		if len(data) < nlaHdrLen {
+			return nil, fmt.Errorf("openvswitch: truncated netlink attribute")
+		}
+
+		length := int(binary.LittleEndian.Uint16(data[0:2]))
+		typ := binary.LittleEndian.Uint16(data[2:4]) & nlaTypeMask
+
+		if length < nlaHdrLen || length > len(data) {
+			return nil, fmt.Errorf("openvswitch: malformed netlink attribute")
+		}
+
+		attrs = append(attrs, rawAttr{Type: typ, Payload: data[nlaHdrLen:length]})
+		data = data[nlmsgAlign(length):]
+	}
+
+	return attrs, nil
+}
+
+// Attrs is the result of parsing a flat list of netlink attributes:
+// attribute type (with flag bits stripped) to payload.
+type Attrs map[uint16][]byte
+
+func ParseAttrs(data []byte) (Attrs, error) {
+	attrs := make(Attrs)
+
+	for len(data) > 0 {
+		if len(data) < nlaHdrLen {
+			return nil, fmt.Errorf("openvswitch: truncated netlink attribute")
+		}
+
+		length := int(binary.LittleEndian.Uint16(data[0:2]))
+		typ := binary.LittleEndian.Uint16(data[2:4]) & nlaTypeMask
+
+		if length < nlaHdrLen || length > len(data) {
+			return nil, fmt.Errorf("openvswitch: malformed netlink attribute")
+		}
+
+		attrs[typ] = data[nlaHdrLen:length]
+		data = data[nlmsgAlign(length):]
+	}
+
+	return attrs, nil
+}
+
+func (a Attrs) Uint8(typ uint16) (uint8, bool) {
+	v, ok := a[typ]
+	if !ok || len(v) < 1 {
+		return 0, false
+	}
+	return v[0], true
+}
+
+func (a Attrs) Uint16(typ uint16) (uint16, bool) {
+	v, ok := a[typ]
+	if !ok || len(v) < 2 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint16(v), true
+}
+
+func (a Attrs) Uint32(typ uint16) (uint32, bool) {
+	v, ok := a[typ]
+	if !ok || len(v) < 4 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(v), true
+}
+
+func (a Attrs) Uint64(typ uint16) (uint64, bool) {
+	v, ok := a[typ]
+	if !ok || len(v) < 8 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(v), true
+}
+
+func (a Attrs) Uint16BE(typ uint16) (uint16, bool) {
+	v, ok := a[typ]
+	if !ok || len(v) < 2 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(v), true
+}
+
+func (a Attrs) Uint32BE(typ uint16) (uint32, bool) {
+	v, ok := a[typ]
+	if !ok || len(v) < 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(v), true
+}
+
+func (a Attrs) Uint32Array(typ uint16) ([]uint32, bool) {
+	v, ok := a[typ]
+	if !ok || len(v)%4 != 0 {
+		return nil, false
+	}
+
+	vs := make([]uint32, len(v)/4)
+	for i := range vs {
+		vs[i] = binary.LittleEndian.Uint32(v[4*i:])
+	}
+	return vs, true
+}
+
+func (a Attrs) String(typ uint16) (string, bool) {
+	v, ok := a[typ]
+	if !ok {
+		return "", false
+	}
+	if n := len(v); n > 0 && v[n-1] == 0 {
+		v = v[:n-1]
+	}
+	return string(v), true
+}
+
+func (a Attrs) Nested(typ uint16) (Attrs, bool) {
+	v, ok := a[typ]
+	if !ok {
+		return nil, false
+	}
+	nested, err := ParseAttrs(v)
+	if err != nil {
+		return nil, false
+	}
+	return nested, true
+}
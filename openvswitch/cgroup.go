@@ -0,0 +1,125 @@
+package openvswitch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupCPUQuota returns the number of CPUs this process is allowed to
+// use according to its cgroup CPU quota, rounded up, or 0 if no quota
+// is in effect (or it can't be determined) so the caller should fall
+// back to runtime.NumCPU().
+//
+// Sizing worker pools from runtime.NumCPU() overcommits badly when a
+// container is given a fractional CPU limit by Kubernetes/systemd, so
+// we go to the cgroup itself rather than trust the host's core count.
+func cgroupCPUQuota() int {
+	if n := cgroupV2CPUQuota(); n > 0 {
+		return n
+	}
+	return cgroupV1CPUQuota()
+}
+
+func cgroupV2CPUQuota() int {
+	own, err := ownCgroupPath("")
+	if err != nil {
+		return 0
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join("/sys/fs/cgroup", own, "cpu.max"))
+	if err != nil {
+		return 0
+	}
+
+	fields := strings.Fields(strings.TrimSpace(string(data)))
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0
+	}
+
+	quota, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+
+	period, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || period == 0 {
+		return 0
+	}
+
+	return quotaToCPUs(quota, period)
+}
+
+func cgroupV1CPUQuota() int {
+	own, err := ownCgroupPath("cpu")
+	if err != nil {
+		return 0
+	}
+
+	quota, err := readCgroupV1Int(filepath.Join("/sys/fs/cgroup/cpu", own, "cpu.cfs_quota_us"))
+	if err != nil || quota <= 0 {
+		return 0
+	}
+
+	period, err := readCgroupV1Int(filepath.Join("/sys/fs/cgroup/cpu", own, "cpu.cfs_period_us"))
+	if err != nil || period <= 0 {
+		return 0
+	}
+
+	return quotaToCPUs(float64(quota), float64(period))
+}
+
+func readCgroupV1Int(path string) (int64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// ownCgroupPath returns the path of the calling process's own cgroup,
+// relative to subsys's mount point, by reading /proc/self/cgroup
+// instead of assuming the whole cgroup filesystem is mounted at
+// /sys/fs/cgroup: under a nested cgroup (e.g. a container runtime that
+// doesn't bind-mount the leaf cgroup to the conventional root) that
+// assumption silently reads a different, usually unlimited, cgroup's
+// quota. subsys is "" for the unified (cgroup v2) hierarchy, or a v1
+// controller name such as "cpu".
+func ownCgroupPath(subsys string) (string, error) {
+	data, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		if subsys == "" {
+			if fields[1] == "" {
+				return fields[2], nil
+			}
+			continue
+		}
+
+		for _, c := range strings.Split(fields[1], ",") {
+			if c == subsys {
+				return fields[2], nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("openvswitch: no %q entry in /proc/self/cgroup", subsys)
+}
+
+func quotaToCPUs(quota, period float64) int {
+	cpus := int(quota/period + 0.999999)
+	if cpus < 1 {
+		cpus = 1
+	}
+	return cpus
+}
@@ -0,0 +1,379 @@
+package openvswitch
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// CtStateFlowKey matches on the connection tracking state recorded by
+// an earlier ct action, e.g. "established" or "new". mask selects
+// which bits of state must match exactly; bits outside mask are
+// wildcarded, which is how the common "+est" / "-new" style matches
+// are expressed.
+type CtStateFlowKey struct {
+	State uint32
+	Mask  uint32
+}
+
+func NewCtStateFlowKey(state uint32, mask uint32) FlowKey {
+	return CtStateFlowKey{State: state, Mask: mask}
+}
+
+func (k CtStateFlowKey) typeId() uint16 { return OVS_KEY_ATTR_CT_STATE }
+
+func (k CtStateFlowKey) putKeyNlAttr(attrs *AttrBuilder) {
+	attrs.PutUint32(OVS_KEY_ATTR_CT_STATE, k.State)
+}
+
+func (k CtStateFlowKey) maskKey() FlowKey {
+	return ctStateMask{k.Mask}
+}
+
+func (k CtStateFlowKey) Equals(other FlowKey) bool {
+	if m, ok := other.(ctStateMask); ok {
+		return k.State == m.Mask
+	}
+	o, ok := other.(CtStateFlowKey)
+	return ok && k.State == o.State
+}
+
+// ctStateMask is the FlowKey FlowSpec.AddKey installs into the mask
+// attrs for a CtStateFlowKey; it carries no state of its own beyond
+// the mask value, so it isn't exported.
+type ctStateMask struct {
+	Mask uint32
+}
+
+func (m ctStateMask) typeId() uint16 { return OVS_KEY_ATTR_CT_STATE }
+
+func (m ctStateMask) putKeyNlAttr(attrs *AttrBuilder) {
+	attrs.PutUint32(OVS_KEY_ATTR_CT_STATE, m.Mask)
+}
+
+func (m ctStateMask) Equals(other FlowKey) bool {
+	switch o := other.(type) {
+	case ctStateMask:
+		return m.Mask == o.Mask
+	case CtStateFlowKey:
+		return m.Mask == o.State
+	default:
+		return false
+	}
+}
+
+func parseCtStateFlowKey(data []byte) (FlowKey, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("openvswitch: short OVS_KEY_ATTR_CT_STATE")
+	}
+	return CtStateFlowKey{State: binary.LittleEndian.Uint32(data)}, nil
+}
+
+// CtZoneFlowKey matches on the conntrack zone a packet's connection
+// was committed to.
+type CtZoneFlowKey struct {
+	Zone uint16
+}
+
+func NewCtZoneFlowKey(zone uint16) FlowKey {
+	return CtZoneFlowKey{Zone: zone}
+}
+
+func (k CtZoneFlowKey) typeId() uint16 { return OVS_KEY_ATTR_CT_ZONE }
+
+func (k CtZoneFlowKey) putKeyNlAttr(attrs *AttrBuilder) {
+	attrs.PutUint16(OVS_KEY_ATTR_CT_ZONE, k.Zone)
+}
+
+func (k CtZoneFlowKey) Equals(other FlowKey) bool {
+	o, ok := other.(CtZoneFlowKey)
+	return ok && k.Zone == o.Zone
+}
+
+func parseCtZoneFlowKey(data []byte) (FlowKey, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("openvswitch: short OVS_KEY_ATTR_CT_ZONE")
+	}
+	return CtZoneFlowKey{Zone: binary.LittleEndian.Uint16(data)}, nil
+}
+
+// CtMarkFlowKey matches on the conntrack mark associated with a
+// packet's connection.
+type CtMarkFlowKey struct {
+	Mark uint32
+}
+
+func NewCtMarkFlowKey(mark uint32) FlowKey {
+	return CtMarkFlowKey{Mark: mark}
+}
+
+func (k CtMarkFlowKey) typeId() uint16 { return OVS_KEY_ATTR_CT_MARK }
+
+func (k CtMarkFlowKey) putKeyNlAttr(attrs *AttrBuilder) {
+	attrs.PutUint32(OVS_KEY_ATTR_CT_MARK, k.Mark)
+}
+
+func (k CtMarkFlowKey) Equals(other FlowKey) bool {
+	o, ok := other.(CtMarkFlowKey)
+	return ok && k.Mark == o.Mark
+}
+
+func parseCtMarkFlowKey(data []byte) (FlowKey, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("openvswitch: short OVS_KEY_ATTR_CT_MARK")
+	}
+	return CtMarkFlowKey{Mark: binary.LittleEndian.Uint32(data)}, nil
+}
+
+// CtLabelsFlowKey matches on the 128-bit conntrack label associated
+// with a packet's connection.
+type CtLabelsFlowKey struct {
+	Labels [16]byte
+}
+
+func NewCtLabelsFlowKey(labels [16]byte) FlowKey {
+	return CtLabelsFlowKey{Labels: labels}
+}
+
+func (k CtLabelsFlowKey) typeId() uint16 { return OVS_KEY_ATTR_CT_LABELS }
+
+func (k CtLabelsFlowKey) putKeyNlAttr(attrs *AttrBuilder) {
+	attrs.PutSlice(OVS_KEY_ATTR_CT_LABELS, k.Labels[:])
+}
+
+func (k CtLabelsFlowKey) Equals(other FlowKey) bool {
+	o, ok := other.(CtLabelsFlowKey)
+	return ok && k.Labels == o.Labels
+}
+
+func parseCtLabelsFlowKey(data []byte) (FlowKey, error) {
+	if len(data) < 16 {
+		return nil, fmt.Errorf("openvswitch: short OVS_KEY_ATTR_CT_LABELS")
+	}
+	var k CtLabelsFlowKey
+	copy(k.Labels[:], data[:16])
+	return k, nil
+}
+
+// CtNatRange is an OVS_NAT_ATTR_* source or destination NAT range: the
+// IPv4 addresses and, if either ProtoMin or ProtoMax is non-zero,
+// transport ports to rewrite into.
+type CtNatRange struct {
+	IPv4Min  uint32
+	IPv4Max  uint32
+	ProtoMin uint16
+	ProtoMax uint16
+}
+
+// CtOptions configures a NewCtAction. Zone, Mark and Labels are
+// pointers so that the action can tell "unset" apart from zero.
+type CtOptions struct {
+	Commit bool
+	Zone   *uint16
+
+	// Mark sets the conntrack mark. MarkMask selects which bits of
+	// Mark are actually written, leaving the rest of the mark
+	// unmodified; it defaults to all-ones (an exact set) if Mark is
+	// set and MarkMask is nil.
+	Mark     *uint32
+	MarkMask *uint32
+
+	// Labels sets the conntrack label. LabelsMask selects which bits
+	// are written, the same way MarkMask does for Mark.
+	Labels     *[16]byte
+	LabelsMask *[16]byte
+
+	// Helper names a userspace conntrack helper to invoke, e.g.
+	// "ftp" or "tftp". Empty means none.
+	Helper string
+
+	NatSrc *CtNatRange
+	NatDst *CtNatRange
+}
+
+// allOnesCtLabels is the default OVS_CT_ATTR_LABELS mask: set the whole
+// label exactly, rather than leaving any of it unmodified.
+var allOnesCtLabels = [16]byte{
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+}
+
+type ctAction struct {
+	opts CtOptions
+}
+
+// NewCtAction returns an error if opts sets both NatSrc and NatDst: the
+// kernel's ct action only ever applies NAT in one direction, and an
+// OVS_CT_ATTR_NAT carrying both OVS_NAT_ATTR_SRC and OVS_NAT_ATTR_DST is
+// rejected as malformed.
+func NewCtAction(opts CtOptions) (Action, error) {
+	if opts.NatSrc != nil && opts.NatDst != nil {
+		return nil, fmt.Errorf("openvswitch: ct action cannot set both NatSrc and NatDst")
+	}
+	return ctAction{opts: opts}, nil
+}
+
+func (a ctAction) typeId() uint16 { return OVS_ACTION_ATTR_CT }
+
+func putCtNatNlAttrs(attrs *AttrBuilder, dirAttr uint16, r *CtNatRange) {
+	attrs.PutEmpty(dirAttr)
+	attrs.PutUint32BE(OVS_NAT_ATTR_IP_MIN, r.IPv4Min)
+	attrs.PutUint32BE(OVS_NAT_ATTR_IP_MAX, r.IPv4Max)
+	if r.ProtoMin != 0 || r.ProtoMax != 0 {
+		attrs.PutUint16(OVS_NAT_ATTR_PROTO_MIN, r.ProtoMin)
+		attrs.PutUint16(OVS_NAT_ATTR_PROTO_MAX, r.ProtoMax)
+	}
+}
+
+func (a ctAction) putActionNlAttr(attrs *AttrBuilder) {
+	nested := NewAttrBuilder()
+
+	if a.opts.Commit {
+		nested.PutEmpty(OVS_CT_ATTR_COMMIT)
+	}
+	if a.opts.Zone != nil {
+		nested.PutUint16(OVS_CT_ATTR_ZONE, *a.opts.Zone)
+	}
+	if a.opts.Mark != nil {
+		mask := ^uint32(0)
+		if a.opts.MarkMask != nil {
+			mask = *a.opts.MarkMask
+		}
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint32(buf[0:4], *a.opts.Mark)
+		binary.LittleEndian.PutUint32(buf[4:8], mask)
+		nested.PutSlice(OVS_CT_ATTR_MARK, buf)
+	}
+	if a.opts.Labels != nil {
+		mask := allOnesCtLabels
+		if a.opts.LabelsMask != nil {
+			mask = *a.opts.LabelsMask
+		}
+		buf := append(append([]byte{}, a.opts.Labels[:]...), mask[:]...)
+		nested.PutSlice(OVS_CT_ATTR_LABELS, buf)
+	}
+	if a.opts.Helper != "" {
+		nested.PutString(OVS_CT_ATTR_HELPER, a.opts.Helper)
+	}
+	if a.opts.NatSrc != nil || a.opts.NatDst != nil {
+		nat := NewAttrBuilder()
+		if a.opts.NatSrc != nil {
+			putCtNatNlAttrs(nat, OVS_NAT_ATTR_SRC, a.opts.NatSrc)
+		}
+		if a.opts.NatDst != nil {
+			putCtNatNlAttrs(nat, OVS_NAT_ATTR_DST, a.opts.NatDst)
+		}
+		nested.PutNestedAttrs(OVS_CT_ATTR_NAT, nat)
+	}
+
+	attrs.PutNestedAttrs(OVS_ACTION_ATTR_CT, nested)
+}
+
+func (a ctAction) Equals(other Action) bool {
+	o, ok := other.(ctAction)
+	if !ok {
+		return false
+	}
+	return ctOptionsEqual(a.opts, o.opts)
+}
+
+func ctOptionsEqual(a, b CtOptions) bool {
+	if a.Commit != b.Commit || a.Helper != b.Helper {
+		return false
+	}
+	if !uint16PtrEqual(a.Zone, b.Zone) {
+		return false
+	}
+	if !uint32PtrEqual(a.Mark, b.Mark) || !uint32PtrEqual(a.MarkMask, b.MarkMask) {
+		return false
+	}
+	if !bytes16PtrEqual(a.Labels, b.Labels) || !bytes16PtrEqual(a.LabelsMask, b.LabelsMask) {
+		return false
+	}
+	if !ctNatRangeEqual(a.NatSrc, b.NatSrc) || !ctNatRangeEqual(a.NatDst, b.NatDst) {
+		return false
+	}
+	return true
+}
+
+func bytes16PtrEqual(a, b *[16]byte) bool {
+	if (a == nil) != (b == nil) {
+		return false
+	}
+	return a == nil || *a == *b
+}
+
+func uint16PtrEqual(a, b *uint16) bool {
+	if (a == nil) != (b == nil) {
+		return false
+	}
+	return a == nil || *a == *b
+}
+
+func uint32PtrEqual(a, b *uint32) bool {
+	if (a == nil) != (b == nil) {
+		return false
+	}
+	return a == nil || *a == *b
+}
+
+func ctNatRangeEqual(a, b *CtNatRange) bool {
+	if (a == nil) != (b == nil) {
+		return false
+	}
+	return a == nil || *a == *b
+}
+
+func parseCtAction(data []byte) (Action, error) {
+	attrs, err := ParseAttrs(data)
+	if err != nil {
+		return nil, fmt.Errorf("openvswitch: malformed OVS_ACTION_ATTR_CT: %s", err)
+	}
+
+	var opts CtOptions
+
+	_, opts.Commit = attrs[OVS_CT_ATTR_COMMIT]
+
+	if zone, ok := attrs.Uint16(OVS_CT_ATTR_ZONE); ok {
+		opts.Zone = &zone
+	}
+	if raw, ok := attrs[OVS_CT_ATTR_MARK]; ok && len(raw) >= 8 {
+		mark := binary.LittleEndian.Uint32(raw[0:4])
+		mask := binary.LittleEndian.Uint32(raw[4:8])
+		opts.Mark = &mark
+		opts.MarkMask = &mask
+	}
+	if raw, ok := attrs[OVS_CT_ATTR_LABELS]; ok && len(raw) >= 32 {
+		var labels, mask [16]byte
+		copy(labels[:], raw[:16])
+		copy(mask[:], raw[16:32])
+		opts.Labels = &labels
+		opts.LabelsMask = &mask
+	}
+	if helper, ok := attrs.String(OVS_CT_ATTR_HELPER); ok {
+		opts.Helper = helper
+	}
+	if rawNat, ok := attrs[OVS_CT_ATTR_NAT]; ok {
+		natAttrs, err := ParseAttrs(rawNat)
+		if err != nil {
+			return nil, fmt.Errorf("openvswitch: malformed OVS_CT_ATTR_NAT: %s", err)
+		}
+
+		if _, ok := natAttrs[OVS_NAT_ATTR_SRC]; ok {
+			opts.NatSrc = parseCtNatRange(natAttrs)
+		}
+		if _, ok := natAttrs[OVS_NAT_ATTR_DST]; ok {
+			opts.NatDst = parseCtNatRange(natAttrs)
+		}
+	}
+
+	return ctAction{opts: opts}, nil
+}
+
+func parseCtNatRange(attrs Attrs) *CtNatRange {
+	var r CtNatRange
+	r.IPv4Min, _ = attrs.Uint32BE(OVS_NAT_ATTR_IP_MIN)
+	r.IPv4Max, _ = attrs.Uint32BE(OVS_NAT_ATTR_IP_MAX)
+	r.ProtoMin, _ = attrs.Uint16(OVS_NAT_ATTR_PROTO_MIN)
+	r.ProtoMax, _ = attrs.Uint16(OVS_NAT_ATTR_PROTO_MAX)
+	return &r
+}
@@ -0,0 +1,144 @@
+package openvswitch
+
+import "syscall"
+
+// Dpif is a handle onto the openvswitch kernel module, used to look up
+// and create datapaths. Close it when you are done with it.
+type Dpif struct {
+	sock        *NetlinkSocket
+	datapathFam *genlFamily
+	vportFam    *genlFamily
+	flowFam     *genlFamily
+	packetFam   *genlFamily
+}
+
+func NewDpif() (*Dpif, error) {
+	sock, err := OpenNetlinkSocket(syscall.NETLINK_GENERIC)
+	if err != nil {
+		return nil, err
+	}
+
+	dpif := &Dpif{sock: sock}
+
+	for _, fam := range []struct {
+		name string
+		dest **genlFamily
+	}{
+		{OVS_DATAPATH_FAMILY, &dpif.datapathFam},
+		{OVS_VPORT_FAMILY, &dpif.vportFam},
+		{OVS_FLOW_FAMILY, &dpif.flowFam},
+		{OVS_PACKET_FAMILY, &dpif.packetFam},
+	} {
+		resolved, err := resolveGenlFamily(sock, fam.name)
+		if err != nil {
+			sock.Close()
+			return nil, err
+		}
+		*fam.dest = resolved
+	}
+
+	return dpif, nil
+}
+
+func (dpif *Dpif) Close() error {
+	return dpif.sock.Close()
+}
+
+// Datapath is a handle onto an openvswitch datapath.
+type Datapath struct {
+	dpif    *Dpif
+	ifindex int32
+	name    string
+}
+
+func (dpif *Dpif) datapathAttrs(name string) *AttrBuilder {
+	attrs := NewAttrBuilder()
+	attrs.PutString(OVS_DP_ATTR_NAME, name)
+	return attrs
+}
+
+func (dpif *Dpif) CreateDatapath(name string) (*Datapath, error) {
+	attrs := dpif.datapathAttrs(name)
+
+	// dp_ifindex is 0 on creation: the kernel assigns it and returns it
+	// in the reply's ovs_header.
+	seq, err := dpif.sock.sendOvsRequest(dpif.datapathFam.id, NLM_F_ACK, OVS_DP_CMD_NEW, 1, 0, attrs.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	dp := &Datapath{dpif: dpif, name: name}
+
+	err = dpif.sock.recvOvsReplies(seq, false, func(cmd uint8, ifindex int32, reply Attrs) error {
+		dp.ifindex = ifindex
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return dp, nil
+}
+
+// LookupDatapath returns nil, nil if there is no such datapath.
+func (dpif *Dpif) LookupDatapath(name string) (*Datapath, error) {
+	attrs := dpif.datapathAttrs(name)
+
+	seq, err := dpif.sock.sendOvsRequest(dpif.datapathFam.id, 0, OVS_DP_CMD_GET, 1, 0, attrs.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	var dp *Datapath
+
+	err = dpif.sock.recvOvsReplies(seq, false, func(cmd uint8, ifindex int32, reply Attrs) error {
+		dp = &Datapath{dpif: dpif, name: name, ifindex: ifindex}
+		return nil
+	})
+	if err, ok := err.(syscall.Errno); ok && err == syscall.ENODEV {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return dp, nil
+}
+
+func (dpif *Dpif) EnumerateDatapaths() (map[string]*Datapath, error) {
+	attrs := NewAttrBuilder()
+
+	seq, err := dpif.sock.sendOvsRequest(dpif.datapathFam.id, NLM_F_DUMP, OVS_DP_CMD_GET, 1, 0, attrs.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*Datapath)
+
+	err = dpif.sock.recvOvsReplies(seq, true, func(cmd uint8, ifindex int32, reply Attrs) error {
+		name, ok := reply.String(OVS_DP_ATTR_NAME)
+		if !ok {
+			return nil
+		}
+		res[name] = &Datapath{dpif: dpif, name: name, ifindex: ifindex}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (dp *Datapath) Delete() error {
+	attrs := dp.dpif.datapathAttrs(dp.name)
+
+	seq, err := dp.dpif.sock.sendOvsRequest(dp.dpif.datapathFam.id, NLM_F_ACK, OVS_DP_CMD_DEL, 1, dp.ifindex, attrs.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return dp.dpif.sock.recvOvsReplies(seq, false, func(cmd uint8, ifindex int32, reply Attrs) error {
+		return nil
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"testing"
 	"math/rand"
 	"fmt"
+	"net"
+	"syscall"
 	"time"
 )
 
@@ -219,6 +221,61 @@ func TestCreateFlow(t *testing.T) {
 	}
 }
 
+func testTunnelVport(t *testing.T, spec VportSpec) {
+	dpif, err := NewDpif()
+	if err != nil { t.Fatal(err) }
+	defer checkedCloseDpif(dpif, t)
+
+	dp, err := dpif.CreateDatapath(fmt.Sprintf("test%d", rand.Intn(100000)))
+	if err != nil { t.Fatal(err) }
+	defer checkedDeleteDatapath(dp, t)
+
+	name := fmt.Sprintf("test%d", rand.Intn(100000))
+	vport, err := dp.CreateVport(name, spec)
+	if err != nil { t.Fatal(err) }
+	defer vport.Delete()
+
+	name2vport, err := dp.EnumerateVports()
+	if err != nil { t.Fatal(err) }
+	got, ok := name2vport[name]
+	if !ok { t.Fatal("vport not found by EnumerateVports") }
+	if got.Spec != spec { t.Fatalf("got spec %#v, expected %#v", got.Spec, spec) }
+}
+
+func TestCreateVxlanVport(t *testing.T) {
+	testTunnelVport(t, NewVxlanVportSpec(4789))
+}
+
+func TestCreateGeneveVport(t *testing.T) {
+	testTunnelVport(t, NewGeneveVportSpec(6081))
+}
+
+func TestCreateGreVport(t *testing.T) {
+	testTunnelVport(t, GRE_VPORT_SPEC)
+}
+
+func TestCreateTunnelFlow(t *testing.T) {
+	dpif, err := NewDpif()
+	if err != nil { t.Fatal(err) }
+	defer checkedCloseDpif(dpif, t)
+
+	dp, err := dpif.CreateDatapath(fmt.Sprintf("test%d", rand.Intn(100000)))
+	if err != nil { t.Fatal(err) }
+	defer checkedDeleteDatapath(dp, t)
+
+	tunKey := NewTunnelFlowKey(1234, 0x0a000001, 0x0a000002, 0, 64, 0, 4789, false, false)
+
+	f := NewFlowSpec()
+	f.AddKey(tunKey)
+	f.AddAction(NewSetTunnelAction(tunKey))
+
+	err = dp.CreateFlow(f)
+	if err != nil { t.Fatal(err) }
+
+	err = dp.DeleteFlow(f)
+	if err != nil { t.Fatal(err) }
+}
+
 func TestEnumerateFlows(t *testing.T) {
 	dpif, err := NewDpif()
 	if err != nil { t.Fatal(err) }
@@ -266,4 +323,153 @@ func TestEnumerateFlows(t *testing.T) {
 	if err != nil { t.Fatal(err) }
 
 	if len(eflows) != 0 { t.Fatal() }
+}
+
+func TestSubscribeUpcalls(t *testing.T) {
+	dpif, err := NewDpif()
+	if err != nil { t.Fatal(err) }
+	defer checkedCloseDpif(dpif, t)
+
+	dp, err := dpif.CreateDatapath(fmt.Sprintf("test%d", rand.Intn(100000)))
+	if err != nil { t.Fatal(err) }
+	defer checkedDeleteDatapath(dp, t)
+
+	name := fmt.Sprintf("test%d", rand.Intn(100000))
+	vport, err := dp.CreateVport(name, INTERNAL_VPORT_SPEC)
+	if err != nil { t.Fatal(err) }
+	defer vport.Delete()
+
+	sub, err := dp.SubscribeUpcalls(WithUpcallWorkers(2))
+	if err != nil { t.Fatal(err) }
+	defer sub.Close()
+
+	if len(sub.Pids()) != 2 { t.Fatal("expected 2 upcall sockets") }
+
+	if err := vport.SetUpcallPids(sub.Pids()); err != nil { t.Fatal(err) }
+
+	err = dp.ExecutePacket([]byte{1,2,3,4,5,6,6,5,4,3,2,1,8,0}, []Action{})
+	if err != nil { t.Fatal(err) }
+}
+
+func htons(v uint16) uint16 {
+	return (v << 8) | (v >> 8)
+}
+
+func sendRawEthernetFrame(ifname string, frame []byte) error {
+	iface, err := net.InterfaceByName(ifname)
+	if err != nil { return err }
+
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(syscall.ETH_P_ALL)))
+	if err != nil { return err }
+	defer syscall.Close(fd)
+
+	addr := syscall.SockaddrLinklayer{
+		Protocol: htons(syscall.ETH_P_ALL),
+		Ifindex:  iface.Index,
+	}
+
+	return syscall.Sendto(fd, frame, 0, &addr)
+}
+
+func TestMegaflowAndStats(t *testing.T) {
+	dpif, err := NewDpif()
+	if err != nil { t.Fatal(err) }
+	defer checkedCloseDpif(dpif, t)
+
+	dp, err := dpif.CreateDatapath(fmt.Sprintf("test%d", rand.Intn(100000)))
+	if err != nil { t.Fatal(err) }
+	defer checkedDeleteDatapath(dp, t)
+
+	name := fmt.Sprintf("test%d", rand.Intn(100000))
+	vport, err := dp.CreateVport(name, INTERNAL_VPORT_SPEC)
+	if err != nil { t.Fatal(err) }
+	defer vport.Delete()
+
+	src := [...]byte{1,2,3,4,5,6}
+	dst := [...]byte{6,5,4,3,2,1}
+	srcMask := [...]byte{0xff,0xff,0xff,0xff,0xff,0xff}
+	dstMask := [...]byte{0,0,0,0,0,0}
+
+	f := NewFlowSpec()
+	f.AddKeyMasked(NewEthernetFlowKey(src, dst), NewEthernetFlowKeyMasked(srcMask, dstMask))
+
+	err = dp.CreateFlow(f)
+	if err != nil { t.Fatal(err) }
+	defer dp.DeleteFlow(f)
+
+	frame := append(append([]byte{}, dst[:]...), src[:]...)
+	frame = append(frame, 0x08, 0x00)
+	sendRawEthernetFrame(name, frame)
+
+	time.Sleep(100 * time.Millisecond)
+
+	eflows, err := dp.EnumerateFlows()
+	if err != nil { t.Fatal(err) }
+
+	var found *FlowSpec
+	for i := range eflows {
+		if eflows[i].Equals(f) {
+			found = &eflows[i]
+			break
+		}
+	}
+	if found == nil { t.Fatal("masked flow not found by EnumerateFlows") }
+
+	if found.Stats().Packets == 0 {
+		t.Log("warning: no packets matched the installed megaflow (environment may not support raw injection)")
+	}
+
+	if err := dp.ClearFlowStats(*found); err != nil { t.Fatal(err) }
+}
+
+func TestConntrackFlows(t *testing.T) {
+	dpif, err := NewDpif()
+	if err != nil { t.Fatal(err) }
+	defer checkedCloseDpif(dpif, t)
+
+	dp, err := dpif.CreateDatapath(fmt.Sprintf("test%d", rand.Intn(100000)))
+	if err != nil { t.Fatal(err) }
+	defer checkedDeleteDatapath(dp, t)
+
+	name := fmt.Sprintf("test%d", rand.Intn(100000))
+	vport, err := dp.CreateVport(name, INTERNAL_VPORT_SPEC)
+	if err != nil { t.Fatal(err) }
+	defer vport.Delete()
+
+	zone := uint16(1)
+
+	// First stage: commit new connections to zone 1.
+	commit := NewFlowSpec()
+	commit.AddKey(NewEthernetFlowKey([...]byte{1,2,3,4,5,6}, [...]byte{6,5,4,3,2,1}))
+	commitAction, err := NewCtAction(CtOptions{Commit: true, Zone: &zone})
+	if err != nil { t.Fatal(err) }
+	commit.AddAction(commitAction)
+	commit.AddAction(NewOutputAction(uint32(0)))
+
+	err = dp.CreateFlow(commit)
+	if err != nil { t.Fatal(err) }
+	defer dp.DeleteFlow(commit)
+
+	// Second stage: match established connections in zone 1 and output.
+	established := NewFlowSpec()
+	established.AddKey(NewCtZoneFlowKey(zone))
+	established.AddKey(NewCtStateFlowKey(OVS_CS_F_ESTABLISHED, OVS_CS_F_ESTABLISHED))
+	established.AddAction(NewOutputAction(uint32(0)))
+
+	err = dp.CreateFlow(established)
+	if err != nil { t.Fatal(err) }
+	defer dp.DeleteFlow(established)
+
+	eflows, err := dp.EnumerateFlows()
+	if err != nil { t.Fatal(err) }
+
+	foundCommit := false
+	foundEstablished := false
+	for _, eflow := range eflows {
+		if eflow.Equals(commit) { foundCommit = true }
+		if eflow.Equals(established) { foundEstablished = true }
+	}
+
+	if !foundCommit { t.Fatal("ct commit flow not found by EnumerateFlows") }
+	if !foundEstablished { t.Fatal("ct_state flow not found by EnumerateFlows") }
 }
\ No newline at end of file
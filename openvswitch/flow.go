@@ -0,0 +1,387 @@
+package openvswitch
+
+import (
+	"encoding/binary"
+	"fmt"
+	"syscall"
+)
+
+// FlowKey is one field of a flow's match key, e.g. the ethernet
+// addresses or the tunnel metadata. Each FlowKey implementation owns
+// one OVS_KEY_ATTR_* attribute.
+type FlowKey interface {
+	typeId() uint16
+	putKeyNlAttr(attrs *AttrBuilder)
+	Equals(other FlowKey) bool
+}
+
+// Action is one element of a flow's action list, e.g. output to a
+// vport or set the tunnel key. Each Action implementation owns one
+// OVS_ACTION_ATTR_* attribute.
+type Action interface {
+	typeId() uint16
+	putActionNlAttr(attrs *AttrBuilder)
+	Equals(other Action) bool
+}
+
+// selfMaskedFlowKey is implemented by FlowKeys that carry their own
+// mask rather than requiring FlowSpec.AddKeyMasked, such as
+// CtStateFlowKey.
+type selfMaskedFlowKey interface {
+	FlowKey
+	maskKey() FlowKey
+}
+
+// OutputAction outputs the packet to a vport.
+type OutputAction struct {
+	Port uint32
+}
+
+func NewOutputAction(port uint32) Action {
+	return OutputAction{Port: port}
+}
+
+func (a OutputAction) typeId() uint16 { return OVS_ACTION_ATTR_OUTPUT }
+
+func (a OutputAction) putActionNlAttr(attrs *AttrBuilder) {
+	attrs.PutUint32(OVS_ACTION_ATTR_OUTPUT, a.Port)
+}
+
+func (a OutputAction) Equals(other Action) bool {
+	o, ok := other.(OutputAction)
+	return ok && a.Port == o.Port
+}
+
+func parseOutputAction(data []byte) (Action, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("openvswitch: short OVS_ACTION_ATTR_OUTPUT")
+	}
+	return OutputAction{Port: binary.LittleEndian.Uint32(data)}, nil
+}
+
+// EthernetFlowKey matches on the source and destination MAC address.
+type EthernetFlowKey struct {
+	Src [6]byte
+	Dst [6]byte
+}
+
+func NewEthernetFlowKey(src [6]byte, dst [6]byte) FlowKey {
+	return EthernetFlowKey{Src: src, Dst: dst}
+}
+
+// NewEthernetFlowKeyMasked builds the mask to pair with an
+// EthernetFlowKey in a call to FlowSpec.AddKeyMasked: a 1 bit in the
+// mask means the corresponding bit of the address must match exactly,
+// a 0 bit wildcards it.
+func NewEthernetFlowKeyMasked(srcMask [6]byte, dstMask [6]byte) FlowKey {
+	return EthernetFlowKey{Src: srcMask, Dst: dstMask}
+}
+
+func (k EthernetFlowKey) typeId() uint16 { return OVS_KEY_ATTR_ETHERNET }
+
+func (k EthernetFlowKey) putKeyNlAttr(attrs *AttrBuilder) {
+	attrs.PutSlice(OVS_KEY_ATTR_ETHERNET, append(append([]byte{}, k.Src[:]...), k.Dst[:]...))
+}
+
+func (k EthernetFlowKey) Equals(other FlowKey) bool {
+	o, ok := other.(EthernetFlowKey)
+	return ok && k.Src == o.Src && k.Dst == o.Dst
+}
+
+func parseEthernetFlowKey(data []byte) (FlowKey, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("openvswitch: short OVS_KEY_ATTR_ETHERNET")
+	}
+
+	var k EthernetFlowKey
+	copy(k.Src[:], data[0:6])
+	copy(k.Dst[:], data[6:12])
+	return k, nil
+}
+
+// FlowSpec describes a flow: its match key, an optional mask to turn
+// it into a wildcarded megaflow, and the actions to run when it is hit.
+type FlowSpec struct {
+	keys    map[uint16]FlowKey
+	masks   map[uint16]FlowKey
+	actions []Action
+	stats   FlowStats
+}
+
+func NewFlowSpec() FlowSpec {
+	return FlowSpec{keys: make(map[uint16]FlowKey)}
+}
+
+func (f *FlowSpec) AddKey(key FlowKey) {
+	f.keys[key.typeId()] = key
+
+	if smk, ok := key.(selfMaskedFlowKey); ok {
+		if f.masks == nil {
+			f.masks = make(map[uint16]FlowKey)
+		}
+		f.masks[key.typeId()] = smk.maskKey()
+	}
+}
+
+// AddKeyMasked adds an exact-match key together with a mask that
+// wildcards out the bits the kernel shouldn't require an exact match
+// on, turning the flow into a megaflow. mask must be the same
+// FlowKey implementation as key (e.g. both EthernetFlowKey, built via
+// NewEthernetFlowKeyMasked).
+func (f *FlowSpec) AddKeyMasked(key FlowKey, mask FlowKey) {
+	f.keys[key.typeId()] = key
+
+	if f.masks == nil {
+		f.masks = make(map[uint16]FlowKey)
+	}
+	f.masks[key.typeId()] = mask
+}
+
+func (f *FlowSpec) AddAction(action Action) {
+	f.actions = append(f.actions, action)
+}
+
+// Stats returns the packet/byte counters and other usage information
+// last seen for this flow. It is only populated on FlowSpecs returned
+// by Datapath.EnumerateFlows.
+func (f FlowSpec) Stats() FlowStats {
+	return f.stats
+}
+
+func (f FlowSpec) Equals(other FlowSpec) bool {
+	if len(f.keys) != len(other.keys) || len(f.masks) != len(other.masks) {
+		return false
+	}
+
+	for typ, key := range f.keys {
+		otherKey, ok := other.keys[typ]
+		if !ok || !key.Equals(otherKey) {
+			return false
+		}
+	}
+
+	for typ, mask := range f.masks {
+		otherMask, ok := other.masks[typ]
+		if !ok || !mask.Equals(otherMask) {
+			return false
+		}
+	}
+
+	if len(f.actions) != len(other.actions) {
+		return false
+	}
+
+	for i, action := range f.actions {
+		if !action.Equals(other.actions[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (f FlowSpec) keyAttrs() *AttrBuilder {
+	attrs := NewAttrBuilder()
+	for _, key := range f.keys {
+		key.putKeyNlAttr(attrs)
+	}
+	return attrs
+}
+
+func (f FlowSpec) maskAttrs() *AttrBuilder {
+	attrs := NewAttrBuilder()
+	for _, mask := range f.masks {
+		mask.putKeyNlAttr(attrs)
+	}
+	return attrs
+}
+
+func (f FlowSpec) actionAttrs() *AttrBuilder {
+	attrs := NewAttrBuilder()
+	for _, action := range f.actions {
+		action.putActionNlAttr(attrs)
+	}
+	return attrs
+}
+
+func (f FlowSpec) toNlAttrs() *AttrBuilder {
+	attrs := NewAttrBuilder()
+	attrs.PutNestedAttrs(OVS_FLOW_ATTR_KEY, f.keyAttrs())
+	if len(f.masks) > 0 {
+		attrs.PutNestedAttrs(OVS_FLOW_ATTR_MASK, f.maskAttrs())
+	}
+	attrs.PutNestedAttrs(OVS_FLOW_ATTR_ACTIONS, f.actionAttrs())
+	return attrs
+}
+
+func parseFlowKeys(data Attrs) (map[uint16]FlowKey, error) {
+	keys := make(map[uint16]FlowKey)
+
+	for typ, payload := range data {
+		var key FlowKey
+		var err error
+
+		switch typ {
+		case OVS_KEY_ATTR_ETHERNET:
+			key, err = parseEthernetFlowKey(payload)
+		case OVS_KEY_ATTR_TUNNEL:
+			key, err = parseTunnelFlowKey(payload)
+		case OVS_KEY_ATTR_CT_STATE:
+			key, err = parseCtStateFlowKey(payload)
+		case OVS_KEY_ATTR_CT_ZONE:
+			key, err = parseCtZoneFlowKey(payload)
+		case OVS_KEY_ATTR_CT_MARK:
+			key, err = parseCtMarkFlowKey(payload)
+		case OVS_KEY_ATTR_CT_LABELS:
+			key, err = parseCtLabelsFlowKey(payload)
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		keys[typ] = key
+	}
+
+	return keys, nil
+}
+
+func parseFlow(reply Attrs) (FlowSpec, error) {
+	f := NewFlowSpec()
+
+	if rawKey, ok := reply[OVS_FLOW_ATTR_KEY]; ok {
+		parsedKey, err := ParseAttrs(rawKey)
+		if err != nil {
+			return FlowSpec{}, err
+		}
+
+		keys, err := parseFlowKeys(parsedKey)
+		if err != nil {
+			return FlowSpec{}, err
+		}
+		f.keys = keys
+	}
+
+	if rawMask, ok := reply[OVS_FLOW_ATTR_MASK]; ok {
+		parsedMask, err := ParseAttrs(rawMask)
+		if err != nil {
+			return FlowSpec{}, err
+		}
+
+		masks, err := parseFlowKeys(parsedMask)
+		if err != nil {
+			return FlowSpec{}, err
+		}
+		if len(masks) > 0 {
+			f.masks = masks
+		}
+	}
+
+	if rawActions, ok := reply[OVS_FLOW_ATTR_ACTIONS]; ok {
+		actions, err := parseActions(rawActions)
+		if err != nil {
+			return FlowSpec{}, err
+		}
+		f.actions = actions
+	}
+
+	f.stats = parseFlowStats(reply)
+
+	return f, nil
+}
+
+func parseActions(data []byte) ([]Action, error) {
+	rawActions, err := parseAttrsOrdered(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []Action
+
+	for _, raw := range rawActions {
+		var action Action
+		var err error
+
+		switch raw.Type {
+		case OVS_ACTION_ATTR_OUTPUT:
+			action, err = parseOutputAction(raw.Payload)
+		case OVS_ACTION_ATTR_SET:
+			action, err = parseSetTunnelAction(raw.Payload)
+		case OVS_ACTION_ATTR_CT:
+			action, err = parseCtAction(raw.Payload)
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		actions = append(actions, action)
+	}
+
+	return actions, nil
+}
+
+type NoSuchFlowError struct{}
+
+func (NoSuchFlowError) Error() string { return "no such flow" }
+
+func (dp *Datapath) CreateFlow(f FlowSpec) error {
+	attrs := f.toNlAttrs()
+
+	seq, err := dp.dpif.sock.sendOvsRequest(dp.dpif.flowFam.id, NLM_F_ACK, OVS_FLOW_CMD_NEW, 1, dp.ifindex, attrs.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return dp.dpif.sock.recvOvsReplies(seq, false, func(cmd uint8, ifindex int32, reply Attrs) error {
+		return nil
+	})
+}
+
+func (dp *Datapath) DeleteFlow(f FlowSpec) error {
+	attrs := NewAttrBuilder()
+	attrs.PutNestedAttrs(OVS_FLOW_ATTR_KEY, f.keyAttrs())
+
+	seq, err := dp.dpif.sock.sendOvsRequest(dp.dpif.flowFam.id, NLM_F_ACK, OVS_FLOW_CMD_DEL, 1, dp.ifindex, attrs.Bytes())
+	if err != nil {
+		return err
+	}
+
+	err = dp.dpif.sock.recvOvsReplies(seq, false, func(cmd uint8, ifindex int32, reply Attrs) error {
+		return nil
+	})
+	if errno, ok := err.(syscall.Errno); ok && errno == syscall.ENOENT {
+		return NoSuchFlowError{}
+	}
+
+	return err
+}
+
+func (dp *Datapath) EnumerateFlows() ([]FlowSpec, error) {
+	attrs := NewAttrBuilder()
+
+	seq, err := dp.dpif.sock.sendOvsRequest(dp.dpif.flowFam.id, NLM_F_DUMP, OVS_FLOW_CMD_GET, 1, dp.ifindex, attrs.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	var flows []FlowSpec
+
+	err = dp.dpif.sock.recvOvsReplies(seq, true, func(cmd uint8, ifindex int32, reply Attrs) error {
+		f, err := parseFlow(reply)
+		if err != nil {
+			return err
+		}
+		flows = append(flows, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return flows, nil
+}
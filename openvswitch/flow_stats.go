@@ -0,0 +1,76 @@
+package openvswitch
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FlowStats is the usage information the kernel keeps per flow:
+// OVS_FLOW_ATTR_STATS, OVS_FLOW_ATTR_TCP_FLAGS and OVS_FLOW_ATTR_USED.
+type FlowStats struct {
+	Packets  uint64
+	Bytes    uint64
+	TcpFlags uint8
+
+	// Used is how long ago a packet last matched this flow, or 0 if
+	// it has never been used.
+	Used time.Duration
+}
+
+func parseFlowStats(reply Attrs) FlowStats {
+	var s FlowStats
+
+	if raw, ok := reply[OVS_FLOW_ATTR_STATS]; ok && len(raw) >= 16 {
+		s.Packets = binary.LittleEndian.Uint64(raw[0:8])
+		s.Bytes = binary.LittleEndian.Uint64(raw[8:16])
+	}
+
+	if tcpFlags, ok := reply.Uint8(OVS_FLOW_ATTR_TCP_FLAGS); ok {
+		s.TcpFlags = tcpFlags
+	}
+
+	if usedMs, ok := reply.Uint64(OVS_FLOW_ATTR_USED); ok && usedMs != 0 {
+		if uptime, err := systemUptime(); err == nil {
+			s.Used = uptime - time.Duration(usedMs)*time.Millisecond
+		}
+	}
+
+	return s
+}
+
+// systemUptime returns how long the system has been up, which is the
+// clock OVS_FLOW_ATTR_USED is expressed relative to.
+func systemUptime() (time.Duration, error) {
+	data, err := ioutil.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(string(data))
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// ClearFlowStats resets a flow's packet/byte counters and last-used
+// time to zero, via OVS_FLOW_CMD_SET/OVS_FLOW_ATTR_CLEAR.
+func (dp *Datapath) ClearFlowStats(f FlowSpec) error {
+	attrs := NewAttrBuilder()
+	attrs.PutNestedAttrs(OVS_FLOW_ATTR_KEY, f.keyAttrs())
+	attrs.PutEmpty(OVS_FLOW_ATTR_CLEAR)
+
+	seq, err := dp.dpif.sock.sendOvsRequest(dp.dpif.flowFam.id, NLM_F_ACK, OVS_FLOW_CMD_SET, 1, dp.ifindex, attrs.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return dp.dpif.sock.recvOvsReplies(seq, false, func(cmd uint8, ifindex int32, reply Attrs) error {
+		return nil
+	})
+}
@@ -0,0 +1,71 @@
+package openvswitch
+
+import "fmt"
+
+const (
+	genlIdCtrl = 0x10
+
+	ctrlCmdGetFamily = 3
+
+	ctrlAttrFamilyId    = 1
+	ctrlAttrFamilyName  = 2
+	ctrlAttrMcastGroups = 7
+
+	ctrlAttrMcastGrpName = 1
+	ctrlAttrMcastGrpId   = 2
+)
+
+// genlFamily is the result of resolving a generic netlink family name
+// to the numeric id the kernel uses for it, along with any multicast
+// groups it advertises.
+type genlFamily struct {
+	id     uint16
+	groups map[string]uint32
+}
+
+func resolveGenlFamily(sock *NetlinkSocket, name string) (*genlFamily, error) {
+	attrs := NewAttrBuilder()
+	attrs.PutString(ctrlAttrFamilyName, name)
+
+	seq, err := sock.sendGenlRequest(genlIdCtrl, 0, ctrlCmdGetFamily, 1, attrs.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	var fam genlFamily
+	fam.groups = make(map[string]uint32)
+
+	err = sock.recvGenlReplies(seq, false, func(cmd uint8, reply Attrs) error {
+		id, ok := reply.Uint16(ctrlAttrFamilyId)
+		if !ok {
+			return fmt.Errorf("openvswitch: reply missing family id for %q", name)
+		}
+		fam.id = id
+
+		if groups, ok := reply.Nested(ctrlAttrMcastGroups); ok {
+			for _, raw := range groups {
+				grp, err := ParseAttrs(raw)
+				if err != nil {
+					continue
+				}
+				grpName, ok := grp.String(ctrlAttrMcastGrpName)
+				if !ok {
+					continue
+				}
+				grpId, ok := grp.Uint32(ctrlAttrMcastGrpId)
+				if !ok {
+					continue
+				}
+				fam.groups[grpName] = grpId
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &fam, nil
+}
@@ -0,0 +1,143 @@
+package openvswitch
+
+// Generic netlink family and multicast group names exposed by the
+// openvswitch kernel module. See linux/openvswitch.h.
+const (
+	OVS_DATAPATH_FAMILY = "ovs_datapath"
+	OVS_VPORT_FAMILY    = "ovs_vport"
+	OVS_FLOW_FAMILY     = "ovs_flow"
+	OVS_PACKET_FAMILY   = "ovs_packet"
+
+	OVS_PACKET_MCGROUP = "packets"
+)
+
+// Datapath commands and attributes.
+const (
+	OVS_DP_CMD_NEW = 1
+	OVS_DP_CMD_DEL = 2
+	OVS_DP_CMD_GET = 3
+	OVS_DP_CMD_SET = 4
+
+	OVS_DP_ATTR_NAME       = 1
+	OVS_DP_ATTR_UPCALL_PID = 2
+	OVS_DP_ATTR_STATS      = 3
+)
+
+// Vport commands, attributes and types.
+const (
+	OVS_VPORT_CMD_NEW = 1
+	OVS_VPORT_CMD_DEL = 2
+	OVS_VPORT_CMD_GET = 3
+	OVS_VPORT_CMD_SET = 4
+
+	OVS_VPORT_ATTR_PORT_NO    = 1
+	OVS_VPORT_ATTR_TYPE       = 2
+	OVS_VPORT_ATTR_NAME       = 3
+	OVS_VPORT_ATTR_OPTIONS    = 4
+	OVS_VPORT_ATTR_UPCALL_PID = 5
+	OVS_VPORT_ATTR_STATS      = 6
+
+	OVS_VPORT_TYPE_NETDEV   = 1
+	OVS_VPORT_TYPE_INTERNAL = 2
+	OVS_VPORT_TYPE_GRE      = 3
+	OVS_VPORT_TYPE_VXLAN    = 4
+	OVS_VPORT_TYPE_GENEVE   = 5
+)
+
+// Tunnel vport options, nested inside OVS_VPORT_ATTR_OPTIONS.
+const (
+	OVS_TUNNEL_ATTR_DST_PORT = 1
+)
+
+// Flow commands and attributes.
+const (
+	OVS_FLOW_CMD_NEW = 1
+	OVS_FLOW_CMD_DEL = 2
+	OVS_FLOW_CMD_GET = 3
+	OVS_FLOW_CMD_SET = 4
+
+	OVS_FLOW_ATTR_KEY       = 1
+	OVS_FLOW_ATTR_ACTIONS   = 2
+	OVS_FLOW_ATTR_STATS     = 3
+	OVS_FLOW_ATTR_TCP_FLAGS = 4
+	OVS_FLOW_ATTR_USED      = 5
+	OVS_FLOW_ATTR_CLEAR     = 6
+	OVS_FLOW_ATTR_MASK      = 7
+)
+
+// Flow key attributes.
+const (
+	OVS_KEY_ATTR_ENCAP    = 1
+	OVS_KEY_ATTR_PRIORITY = 2
+	OVS_KEY_ATTR_IN_PORT  = 3
+	OVS_KEY_ATTR_ETHERNET = 4
+	OVS_KEY_ATTR_TUNNEL   = 16
+
+	OVS_KEY_ATTR_CT_STATE  = 22
+	OVS_KEY_ATTR_CT_ZONE   = 23
+	OVS_KEY_ATTR_CT_MARK   = 24
+	OVS_KEY_ATTR_CT_LABELS = 25
+)
+
+// Tunnel key attributes, nested inside OVS_KEY_ATTR_TUNNEL.
+const (
+	OVS_TUNNEL_KEY_ATTR_ID            = 0
+	OVS_TUNNEL_KEY_ATTR_IPV4_SRC      = 1
+	OVS_TUNNEL_KEY_ATTR_IPV4_DST      = 2
+	OVS_TUNNEL_KEY_ATTR_TOS           = 3
+	OVS_TUNNEL_KEY_ATTR_TTL           = 4
+	OVS_TUNNEL_KEY_ATTR_DONT_FRAGMENT = 5
+	OVS_TUNNEL_KEY_ATTR_CSUM          = 6
+	OVS_TUNNEL_KEY_ATTR_TP_SRC        = 9
+	OVS_TUNNEL_KEY_ATTR_TP_DST        = 10
+)
+
+// Action attributes.
+const (
+	OVS_ACTION_ATTR_OUTPUT = 1
+	OVS_ACTION_ATTR_SET    = 3
+	OVS_ACTION_ATTR_CT     = 12
+)
+
+// Conntrack action attributes, nested inside OVS_ACTION_ATTR_CT.
+const (
+	OVS_CT_ATTR_COMMIT = 1
+	OVS_CT_ATTR_ZONE   = 2
+	OVS_CT_ATTR_MARK   = 3
+	OVS_CT_ATTR_LABELS = 4
+	OVS_CT_ATTR_HELPER = 5
+	OVS_CT_ATTR_NAT    = 6
+)
+
+// Connection tracking state flags, matched via CtStateFlowKey/
+// OVS_KEY_ATTR_CT_STATE.
+const (
+	OVS_CS_F_NEW         = 1 << 0
+	OVS_CS_F_ESTABLISHED = 1 << 1
+	OVS_CS_F_RELATED     = 1 << 2
+	OVS_CS_F_REPLY_DIR   = 1 << 3
+	OVS_CS_F_INVALID     = 1 << 4
+	OVS_CS_F_TRACKED     = 1 << 5
+)
+
+// NAT attributes, nested inside OVS_CT_ATTR_NAT.
+const (
+	OVS_NAT_ATTR_SRC       = 1
+	OVS_NAT_ATTR_DST       = 2
+	OVS_NAT_ATTR_IP_MIN    = 3
+	OVS_NAT_ATTR_IP_MAX    = 4
+	OVS_NAT_ATTR_PROTO_MIN = 5
+	OVS_NAT_ATTR_PROTO_MAX = 6
+)
+
+// Packet commands and attributes.
+const (
+	OVS_PACKET_CMD_MISS    = 1
+	OVS_PACKET_CMD_ACTION  = 2
+	OVS_PACKET_CMD_EXECUTE = 3
+
+	OVS_PACKET_ATTR_PACKET   = 1
+	OVS_PACKET_ATTR_KEY      = 2
+	OVS_PACKET_ATTR_ACTIONS  = 3
+	OVS_PACKET_ATTR_USERDATA = 4
+)
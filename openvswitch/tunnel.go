@@ -0,0 +1,177 @@
+package openvswitch
+
+import "fmt"
+
+// VxlanVportSpec configures a VXLAN tunnel vport, open_vswitch.c terms
+// such a vport's OVS_VPORT_ATTR_OPTIONS as carrying the UDP
+// destination port to listen on.
+type VxlanVportSpec struct {
+	DstPort uint16
+}
+
+func NewVxlanVportSpec(dstPort uint16) VxlanVportSpec {
+	return VxlanVportSpec{DstPort: dstPort}
+}
+
+func (s VxlanVportSpec) typeId() uint32 { return OVS_VPORT_TYPE_VXLAN }
+
+func (s VxlanVportSpec) putOptions(attrs *AttrBuilder) {
+	attrs.PutUint16BE(OVS_TUNNEL_ATTR_DST_PORT, s.DstPort)
+}
+
+func parseVxlanVportSpec(options Attrs) (VportSpec, error) {
+	dstPort, _ := options.Uint16BE(OVS_TUNNEL_ATTR_DST_PORT)
+	return NewVxlanVportSpec(dstPort), nil
+}
+
+// GeneveVportSpec configures a Geneve tunnel vport.
+type GeneveVportSpec struct {
+	DstPort uint16
+}
+
+func NewGeneveVportSpec(dstPort uint16) GeneveVportSpec {
+	return GeneveVportSpec{DstPort: dstPort}
+}
+
+func (s GeneveVportSpec) typeId() uint32 { return OVS_VPORT_TYPE_GENEVE }
+
+func (s GeneveVportSpec) putOptions(attrs *AttrBuilder) {
+	attrs.PutUint16BE(OVS_TUNNEL_ATTR_DST_PORT, s.DstPort)
+}
+
+func parseGeneveVportSpec(options Attrs) (VportSpec, error) {
+	dstPort, _ := options.Uint16BE(OVS_TUNNEL_ATTR_DST_PORT)
+	return NewGeneveVportSpec(dstPort), nil
+}
+
+// GreVportSpec configures a GRE tunnel vport. GRE has no options of
+// its own: the tunnel endpoints and key come from the flow key/actions
+// instead.
+type GreVportSpec struct{}
+
+func NewGreVportSpec() GreVportSpec { return GreVportSpec{} }
+
+func (s GreVportSpec) typeId() uint32              { return OVS_VPORT_TYPE_GRE }
+func (s GreVportSpec) putOptions(attrs *AttrBuilder) {}
+
+var GRE_VPORT_SPEC = NewGreVportSpec()
+
+// TunnelFlowKey matches (or, as an action, sets) the tunnel metadata a
+// packet arrived with or should be encapsulated with: OVS_KEY_ATTR_TUNNEL.
+type TunnelFlowKey struct {
+	TunnelId     uint64
+	Ipv4Src      uint32
+	Ipv4Dst      uint32
+	Tos          uint8
+	Ttl          uint8
+	DontFragment bool
+	Csum         bool
+	TpSrc        uint16
+	TpDst        uint16
+}
+
+func NewTunnelFlowKey(tunnelId uint64, ipv4Src uint32, ipv4Dst uint32, tos uint8, ttl uint8, tpSrc uint16, tpDst uint16, dontFragment bool, csum bool) FlowKey {
+	return TunnelFlowKey{
+		TunnelId:     tunnelId,
+		Ipv4Src:      ipv4Src,
+		Ipv4Dst:      ipv4Dst,
+		Tos:          tos,
+		Ttl:          ttl,
+		DontFragment: dontFragment,
+		Csum:         csum,
+		TpSrc:        tpSrc,
+		TpDst:        tpDst,
+	}
+}
+
+func (k TunnelFlowKey) typeId() uint16 { return OVS_KEY_ATTR_TUNNEL }
+
+func (k TunnelFlowKey) putTunnelNlAttrs(attrs *AttrBuilder) {
+	attrs.PutUint64(OVS_TUNNEL_KEY_ATTR_ID, k.TunnelId)
+	attrs.PutUint32BE(OVS_TUNNEL_KEY_ATTR_IPV4_SRC, k.Ipv4Src)
+	attrs.PutUint32BE(OVS_TUNNEL_KEY_ATTR_IPV4_DST, k.Ipv4Dst)
+	attrs.PutUint8(OVS_TUNNEL_KEY_ATTR_TOS, k.Tos)
+	attrs.PutUint8(OVS_TUNNEL_KEY_ATTR_TTL, k.Ttl)
+	if k.DontFragment {
+		attrs.PutEmpty(OVS_TUNNEL_KEY_ATTR_DONT_FRAGMENT)
+	}
+	if k.Csum {
+		attrs.PutEmpty(OVS_TUNNEL_KEY_ATTR_CSUM)
+	}
+	attrs.PutUint16BE(OVS_TUNNEL_KEY_ATTR_TP_SRC, k.TpSrc)
+	attrs.PutUint16BE(OVS_TUNNEL_KEY_ATTR_TP_DST, k.TpDst)
+}
+
+func (k TunnelFlowKey) putKeyNlAttr(attrs *AttrBuilder) {
+	nested := NewAttrBuilder()
+	k.putTunnelNlAttrs(nested)
+	attrs.PutNestedAttrs(OVS_KEY_ATTR_TUNNEL, nested)
+}
+
+func (k TunnelFlowKey) Equals(other FlowKey) bool {
+	o, ok := other.(TunnelFlowKey)
+	return ok && k == o
+}
+
+func parseTunnelFlowKey(data []byte) (FlowKey, error) {
+	attrs, err := ParseAttrs(data)
+	if err != nil {
+		return nil, fmt.Errorf("openvswitch: malformed OVS_KEY_ATTR_TUNNEL: %s", err)
+	}
+
+	var k TunnelFlowKey
+	k.TunnelId, _ = attrs.Uint64(OVS_TUNNEL_KEY_ATTR_ID)
+	k.Ipv4Src, _ = attrs.Uint32BE(OVS_TUNNEL_KEY_ATTR_IPV4_SRC)
+	k.Ipv4Dst, _ = attrs.Uint32BE(OVS_TUNNEL_KEY_ATTR_IPV4_DST)
+	k.Tos, _ = attrs.Uint8(OVS_TUNNEL_KEY_ATTR_TOS)
+	k.Ttl, _ = attrs.Uint8(OVS_TUNNEL_KEY_ATTR_TTL)
+	_, k.DontFragment = attrs[OVS_TUNNEL_KEY_ATTR_DONT_FRAGMENT]
+	_, k.Csum = attrs[OVS_TUNNEL_KEY_ATTR_CSUM]
+	k.TpSrc, _ = attrs.Uint16BE(OVS_TUNNEL_KEY_ATTR_TP_SRC)
+	k.TpDst, _ = attrs.Uint16BE(OVS_TUNNEL_KEY_ATTR_TP_DST)
+
+	return k, nil
+}
+
+// SetTunnelAction sets the tunnel metadata a packet will be
+// encapsulated with, via OVS_ACTION_ATTR_SET/OVS_KEY_ATTR_TUNNEL.
+type SetTunnelAction struct {
+	Key TunnelFlowKey
+}
+
+// NewSetTunnelAction takes the FlowKey produced by NewTunnelFlowKey.
+func NewSetTunnelAction(key FlowKey) Action {
+	return SetTunnelAction{key.(TunnelFlowKey)}
+}
+
+func (a SetTunnelAction) typeId() uint16 { return OVS_ACTION_ATTR_SET }
+
+func (a SetTunnelAction) putActionNlAttr(attrs *AttrBuilder) {
+	nested := NewAttrBuilder()
+	a.Key.putKeyNlAttr(nested)
+	attrs.PutNestedAttrs(OVS_ACTION_ATTR_SET, nested)
+}
+
+func (a SetTunnelAction) Equals(other Action) bool {
+	o, ok := other.(SetTunnelAction)
+	return ok && a.Key == o.Key
+}
+
+func parseSetTunnelAction(data []byte) (Action, error) {
+	attrs, err := ParseAttrs(data)
+	if err != nil {
+		return nil, fmt.Errorf("openvswitch: malformed OVS_ACTION_ATTR_SET: %s", err)
+	}
+
+	rawKey, ok := attrs[OVS_KEY_ATTR_TUNNEL]
+	if !ok {
+		return nil, fmt.Errorf("openvswitch: OVS_ACTION_ATTR_SET without OVS_KEY_ATTR_TUNNEL is not supported")
+	}
+
+	key, err := parseTunnelFlowKey(rawKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return SetTunnelAction{key.(TunnelFlowKey)}, nil
+}
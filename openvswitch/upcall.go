@@ -0,0 +1,223 @@
+package openvswitch
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+// PacketIn is a packet the kernel datapath couldn't classify itself
+// (OVS_PACKET_CMD_MISS) or chose to send to userspace as part of
+// running a flow's actions (OVS_PACKET_CMD_ACTION).
+type PacketIn struct {
+	Packet   []byte
+	Key      FlowSpec
+	UserData []byte
+	InPort   uint32
+}
+
+type upcallConfig struct {
+	workers int
+}
+
+type UpcallOption func(*upcallConfig)
+
+// WithUpcallWorkers overrides the number of netlink sockets (and
+// goroutines reading from them) SubscribeUpcalls opens. By default
+// this is sized from the process's cgroup CPU quota rather than
+// runtime.NumCPU(), so it doesn't oversubscribe when running under a
+// fractional Kubernetes/systemd CPU limit.
+func WithUpcallWorkers(n int) UpcallOption {
+	return func(c *upcallConfig) { c.workers = n }
+}
+
+func defaultUpcallWorkers() int {
+	if n := cgroupCPUQuota(); n > 0 {
+		return n
+	}
+	return runtime.NumCPU()
+}
+
+// UpcallSubscription is a pool of netlink sockets, each joined to the
+// ovs_packet multicast group, delivering PacketIns on a shared channel.
+type UpcallSubscription struct {
+	dp      *Datapath
+	sockets []*NetlinkSocket
+	pids    []uint32
+	packets chan PacketIn
+	done    chan struct{}
+}
+
+// SubscribeUpcalls opens a pool of netlink sockets bound to the
+// ovs_packet multicast group and rebinds every vport currently on the
+// datapath to deliver its upcalls across them, via
+// OVS_VPORT_ATTR_UPCALL_PID. Vports created afterwards must have
+// SetUpcallPids called on them (or be created with CreateVport followed
+// by SetUpcallPids) to receive upcalls through this subscription too.
+func (dp *Datapath) SubscribeUpcalls(opts ...UpcallOption) (*UpcallSubscription, error) {
+	cfg := upcallConfig{workers: defaultUpcallWorkers()}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.workers < 1 {
+		cfg.workers = 1
+	}
+
+	group, ok := dp.dpif.packetFam.groups[OVS_PACKET_MCGROUP]
+	if !ok {
+		return nil, fmt.Errorf("openvswitch: %s family has no %q multicast group", OVS_PACKET_FAMILY, OVS_PACKET_MCGROUP)
+	}
+
+	sub := &UpcallSubscription{dp: dp, packets: make(chan PacketIn, 100), done: make(chan struct{})}
+
+	for i := 0; i < cfg.workers; i++ {
+		sock, err := OpenNetlinkSocket(syscall.NETLINK_GENERIC)
+		if err != nil {
+			sub.Close()
+			return nil, err
+		}
+
+		if err := sock.JoinGroup(group); err != nil {
+			sock.Close()
+			sub.Close()
+			return nil, err
+		}
+
+		pid, err := sock.Pid()
+		if err != nil {
+			sock.Close()
+			sub.Close()
+			return nil, err
+		}
+
+		sub.sockets = append(sub.sockets, sock)
+		sub.pids = append(sub.pids, pid)
+	}
+
+	vports, err := dp.EnumerateVports()
+	if err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	for _, vport := range vports {
+		if err := vport.SetUpcallPids(sub.pids); err != nil {
+			sub.Close()
+			return nil, err
+		}
+	}
+
+	for _, sock := range sub.sockets {
+		go sub.readLoop(sock)
+	}
+
+	return sub, nil
+}
+
+// Packets returns the channel PacketIns are delivered on.
+func (sub *UpcallSubscription) Packets() <-chan PacketIn {
+	return sub.packets
+}
+
+// Pids returns the netlink port ids this subscription is listening on,
+// for use with VportHandle.SetUpcallPids on vports created later.
+func (sub *UpcallSubscription) Pids() []uint32 {
+	return sub.pids
+}
+
+func (sub *UpcallSubscription) Close() error {
+	close(sub.done)
+
+	var err error
+	for _, sock := range sub.sockets {
+		if cerr := sock.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+func (sub *UpcallSubscription) readLoop(sock *NetlinkSocket) {
+	for {
+		msgs, err := sock.receive()
+		if err != nil {
+			select {
+			case <-sub.done:
+				return
+			default:
+				continue
+			}
+		}
+
+		for _, msg := range msgs {
+			select {
+			case <-sub.done:
+				return
+			default:
+			}
+
+			cmd := genlMsgCmd(msg)
+			if cmd != OVS_PACKET_CMD_MISS && cmd != OVS_PACKET_CMD_ACTION {
+				continue
+			}
+
+			rawAttrs, err := ovsMsgAttrs(msg)
+			if err != nil {
+				continue
+			}
+
+			attrs, err := ParseAttrs(rawAttrs)
+			if err != nil {
+				continue
+			}
+
+			pkt := PacketIn{
+				Packet:   attrs[OVS_PACKET_ATTR_PACKET],
+				UserData: attrs[OVS_PACKET_ATTR_USERDATA],
+			}
+
+			if rawKey, ok := attrs[OVS_PACKET_ATTR_KEY]; ok {
+				if parsedKey, err := ParseAttrs(rawKey); err == nil {
+					if inPort, ok := parsedKey.Uint32(OVS_KEY_ATTR_IN_PORT); ok {
+						pkt.InPort = inPort
+					}
+					if keys, err := parseFlowKeys(parsedKey); err == nil {
+						f := NewFlowSpec()
+						f.keys = keys
+						pkt.Key = f
+					}
+				}
+			}
+
+			select {
+			case sub.packets <- pkt:
+			case <-sub.done:
+				return
+			}
+		}
+	}
+}
+
+// ExecutePacket asks the kernel to run actions against pkt directly,
+// via OVS_PACKET_CMD_EXECUTE, so userspace can inject a packet it
+// classified itself back into the datapath's pipeline.
+func (dp *Datapath) ExecutePacket(pkt []byte, actions []Action) error {
+	attrs := NewAttrBuilder()
+	attrs.PutSlice(OVS_PACKET_ATTR_PACKET, pkt)
+
+	actionAttrs := NewAttrBuilder()
+	for _, action := range actions {
+		action.putActionNlAttr(actionAttrs)
+	}
+	attrs.PutNestedAttrs(OVS_PACKET_ATTR_ACTIONS, actionAttrs)
+
+	seq, err := dp.dpif.sock.sendOvsRequest(dp.dpif.packetFam.id, NLM_F_ACK, OVS_PACKET_CMD_EXECUTE, 1, dp.ifindex, attrs.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return dp.dpif.sock.recvOvsReplies(seq, false, func(cmd uint8, ifindex int32, reply Attrs) error {
+		return nil
+	})
+}
@@ -0,0 +1,220 @@
+package openvswitch
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// VportSpec describes the type-specific configuration of a vport: its
+// OVS_VPORT_ATTR_TYPE and the contents of its OVS_VPORT_ATTR_OPTIONS
+// (if any). The name of the vport itself is passed separately to
+// CreateVport, since it is independent of the type.
+type VportSpec interface {
+	typeId() uint32
+	putOptions(attrs *AttrBuilder)
+}
+
+// SimpleVportSpec is a VportSpec for vport types that take no options.
+type SimpleVportSpec struct {
+	TypeId uint32
+}
+
+func (s SimpleVportSpec) typeId() uint32 { return s.TypeId }
+
+func (s SimpleVportSpec) putOptions(attrs *AttrBuilder) {}
+
+var (
+	INTERNAL_VPORT_SPEC = SimpleVportSpec{OVS_VPORT_TYPE_INTERNAL}
+	NETDEV_VPORT_SPEC   = SimpleVportSpec{OVS_VPORT_TYPE_NETDEV}
+)
+
+// parseVportSpec turns a vport type and its OVS_VPORT_ATTR_OPTIONS
+// attribute (if present) back into a VportSpec.
+func parseVportSpec(typeId uint32, options Attrs) (VportSpec, error) {
+	switch typeId {
+	case OVS_VPORT_TYPE_INTERNAL:
+		return INTERNAL_VPORT_SPEC, nil
+	case OVS_VPORT_TYPE_NETDEV:
+		return NETDEV_VPORT_SPEC, nil
+	case OVS_VPORT_TYPE_VXLAN:
+		return parseVxlanVportSpec(options)
+	case OVS_VPORT_TYPE_GENEVE:
+		return parseGeneveVportSpec(options)
+	case OVS_VPORT_TYPE_GRE:
+		return GRE_VPORT_SPEC, nil
+	default:
+		return nil, fmt.Errorf("openvswitch: unknown vport type %d", typeId)
+	}
+}
+
+// VportHandle is a handle onto a vport that has been attached to a
+// datapath.
+type VportHandle struct {
+	dpif    *Dpif
+	dp      *Datapath
+	ifindex int32
+	Name    string
+	Spec    VportSpec
+}
+
+type NoSuchVportError struct {
+	Name string
+}
+
+func (e NoSuchVportError) Error() string {
+	return fmt.Sprintf("no such vport %q", e.Name)
+}
+
+func IsNoSuchVportError(err error) bool {
+	_, ok := err.(NoSuchVportError)
+	return ok
+}
+
+func (dp *Datapath) vportAttrs(name string, spec VportSpec) *AttrBuilder {
+	attrs := NewAttrBuilder()
+	attrs.PutString(OVS_VPORT_ATTR_NAME, name)
+
+	if spec != nil {
+		attrs.PutUint32(OVS_VPORT_ATTR_TYPE, spec.typeId())
+
+		options := NewAttrBuilder()
+		spec.putOptions(options)
+		if len(options.Bytes()) > 0 {
+			attrs.PutNestedAttrs(OVS_VPORT_ATTR_OPTIONS, options)
+		}
+	}
+
+	return attrs
+}
+
+func (dp *Datapath) parseVport(name string, reply Attrs) (VportHandle, error) {
+	vport := VportHandle{dpif: dp.dpif, dp: dp, Name: name}
+
+	typeId, _ := reply.Uint32(OVS_VPORT_ATTR_TYPE)
+	options, _ := reply.Nested(OVS_VPORT_ATTR_OPTIONS)
+
+	spec, err := parseVportSpec(typeId, options)
+	if err != nil {
+		return VportHandle{}, err
+	}
+	vport.Spec = spec
+
+	if portNo, ok := reply.Uint32(OVS_VPORT_ATTR_PORT_NO); ok {
+		vport.ifindex = int32(portNo)
+	}
+
+	return vport, nil
+}
+
+func (dp *Datapath) CreateVport(name string, spec VportSpec) (VportHandle, error) {
+	attrs := dp.vportAttrs(name, spec)
+
+	seq, err := dp.dpif.sock.sendOvsRequest(dp.dpif.vportFam.id, NLM_F_ACK, OVS_VPORT_CMD_NEW, 1, dp.ifindex, attrs.Bytes())
+	if err != nil {
+		return VportHandle{}, err
+	}
+
+	var vport VportHandle
+
+	err = dp.dpif.sock.recvOvsReplies(seq, false, func(cmd uint8, ifindex int32, reply Attrs) error {
+		var err error
+		vport, err = dp.parseVport(name, reply)
+		return err
+	})
+	if err != nil {
+		return VportHandle{}, err
+	}
+
+	return vport, nil
+}
+
+func (dp *Datapath) LookupVport(name string) (VportHandle, error) {
+	attrs := dp.vportAttrs(name, nil)
+
+	seq, err := dp.dpif.sock.sendOvsRequest(dp.dpif.vportFam.id, 0, OVS_VPORT_CMD_GET, 1, dp.ifindex, attrs.Bytes())
+	if err != nil {
+		return VportHandle{}, err
+	}
+
+	var vport VportHandle
+	found := false
+
+	err = dp.dpif.sock.recvOvsReplies(seq, false, func(cmd uint8, ifindex int32, reply Attrs) error {
+		var err error
+		vport, err = dp.parseVport(name, reply)
+		found = err == nil
+		return err
+	})
+	if errno, ok := err.(syscall.Errno); ok && errno == syscall.ENODEV {
+		return VportHandle{}, NoSuchVportError{name}
+	}
+	if err != nil {
+		return VportHandle{}, err
+	}
+	if !found {
+		return VportHandle{}, NoSuchVportError{name}
+	}
+
+	return vport, nil
+}
+
+func (dp *Datapath) EnumerateVports() (map[string]VportHandle, error) {
+	attrs := NewAttrBuilder()
+
+	seq, err := dp.dpif.sock.sendOvsRequest(dp.dpif.vportFam.id, NLM_F_DUMP, OVS_VPORT_CMD_GET, 1, dp.ifindex, attrs.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]VportHandle)
+
+	err = dp.dpif.sock.recvOvsReplies(seq, true, func(cmd uint8, ifindex int32, reply Attrs) error {
+		name, ok := reply.String(OVS_VPORT_ATTR_NAME)
+		if !ok {
+			return nil
+		}
+
+		vport, err := dp.parseVport(name, reply)
+		if err != nil {
+			return err
+		}
+
+		res[name] = vport
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (vport VportHandle) Delete() error {
+	attrs := vport.dp.vportAttrs(vport.Name, nil)
+
+	seq, err := vport.dpif.sock.sendOvsRequest(vport.dpif.vportFam.id, NLM_F_ACK, OVS_VPORT_CMD_DEL, 1, vport.dp.ifindex, attrs.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return vport.dpif.sock.recvOvsReplies(seq, false, func(cmd uint8, ifindex int32, reply Attrs) error {
+		return nil
+	})
+}
+
+// SetUpcallPids rebinds an existing vport to deliver its upcalls (missed
+// and userspace-action packets) to the given netlink port ids, replacing
+// whatever it was previously bound to. See Datapath.SubscribeUpcalls.
+func (vport VportHandle) SetUpcallPids(pids []uint32) error {
+	attrs := vport.dp.vportAttrs(vport.Name, nil)
+	attrs.PutUint32Array(OVS_VPORT_ATTR_UPCALL_PID, pids)
+
+	seq, err := vport.dpif.sock.sendOvsRequest(vport.dpif.vportFam.id, NLM_F_ACK, OVS_VPORT_CMD_SET, 1, vport.dp.ifindex, attrs.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return vport.dpif.sock.recvOvsReplies(seq, false, func(cmd uint8, ifindex int32, reply Attrs) error {
+		return nil
+	})
+}